@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APIRequest is the JSON body accepted by POST /search, modeled after
+// Zoekt's REST search shape.
+type APIRequest struct {
+	Query     string `json:"query"`
+	From      int    `json:"from"`
+	Size      int    `json:"size"`
+	Highlight bool   `json:"highlight"`
+	// Fields, if non-empty, restricts which of Hit's provenance fields
+	// (play, act, scene, speaker) are populated; any not named are left
+	// zero. An empty list returns all of them.
+	Fields []string `json:"fields"`
+	// Format controls how Highlight matches are rendered into Hit.Snippet:
+	// "html" (the default) wraps them in <mark>, "ansi" bolds them with
+	// terminal escapes, "none" leaves the snippet unmarked.
+	Format string `json:"format,omitempty"`
+	// Dedupe controls near-duplicate snippet collapsing: "off" returns
+	// every window, "exact" (the default) merges windows with the same
+	// normalized text, and "fuzzy" merges windows whose MinHash-estimated
+	// Jaccard similarity exceeds the threshold (see dedupe.go).
+	Dedupe string `json:"dedupe,omitempty"`
+}
+
+// APIResponse is the JSON body returned by POST /search.
+type APIResponse struct {
+	Hits     []Hit         `json:"hits"`
+	Total    int           `json:"total"`
+	TookMs   int64         `json:"took_ms"`
+	Replaced []Replacement `json:"replaced"`
+}
+
+// Replacement records a fuzzy spelling correction the searcher made.
+type Replacement struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// HitFragment is a single matched span within a Hit's Snippet, given as a
+// rune-offset range relative to the start of Snippet.
+type HitFragment struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Term  string `json:"term"`
+}
+
+// Hit is a single search result in the REST API shape.
+type Hit struct {
+	Snippet   string        `json:"snippet"`
+	PreMatch  string        `json:"preMatch"`
+	PostMatch string        `json:"postMatch"`
+	Fragments []HitFragment `json:"fragments,omitempty"`
+	Play      string        `json:"play,omitempty"`
+	Act       string        `json:"act,omitempty"`
+	Scene     string        `json:"scene,omitempty"`
+	Speaker   string        `json:"speaker,omitempty"`
+	Score     float64       `json:"score"`
+	// Duplicates and DuplicatePositions are filled in when dedupe merged
+	// one or more near-identical windows into this one; DuplicatePositions
+	// holds each merged window's corpus position so a UI can offer to
+	// expand "N similar results" on demand.
+	Duplicates         int   `json:"duplicates,omitempty"`
+	DuplicatePositions []int `json:"duplicatePositions,omitempty"`
+}
+
+// scoredWindow pairs a cluster of hits with its relevance score, so it can
+// be sorted and paginated before snippets are built.
+type scoredWindow struct {
+	window []matchHit
+	score  float64
+	// duplicates and duplicatePositions are filled in by dedupeWindows
+	// when one or more near-identical windows were merged into this one.
+	duplicates         int
+	duplicatePositions []int
+}
+
+// rankedWindows parses and evaluates req.Query, then returns its windows
+// sorted by descending score and paginated by req.From/req.Size, alongside
+// the fuzzy replacements that were made. It's the core shared by the
+// legacy GET /search, the POST /search REST endpoint, and /search/stream.
+func (s *Searcher) rankedWindows(req APIRequest) (windows []scoredWindow, replaced []Replacement, total int) {
+	if len(req.Query) < 2 {
+		return nil, nil, 0
+	}
+
+	ast, err := ParseQuery(req.Query)
+	if err != nil {
+		return nil, nil, 0
+	}
+
+	hits := ast.Eval(s)
+	if len(hits) == 0 {
+		return nil, nil, 0
+	}
+
+	seen := map[string]bool{}
+	for _, h := range hits {
+		if h.Original != "" && !seen[h.Original] {
+			replaced = append(replaced, Replacement{From: h.Original, To: h.Term})
+			seen[h.Original] = true
+		}
+	}
+
+	rawWindows := buildWindows(hits, clusterWindow)
+	scored := make([]scoredWindow, 0, len(rawWindows))
+	for _, w := range rawWindows {
+		if len(w) == 0 {
+			continue
+		}
+		score, _, _ := s.scoreWindow(w)
+		scored = append(scored, scoredWindow{window: w, score: score})
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+	scored = dedupeWindows(scored, s.windowText, req.Dedupe)
+	total = len(scored)
+
+	from := req.From
+	if from < 0 {
+		from = 0
+	}
+	if from > len(scored) {
+		from = len(scored)
+	}
+	scored = scored[from:]
+
+	size := req.Size
+	if size <= 0 {
+		size = 20
+	}
+	if size < len(scored) {
+		scored = scored[:size]
+	}
+
+	return scored, replaced, total
+}
+
+var highlighter = Highlighter{}
+
+// windowText returns the plain text of the window's best fragment, used as
+// the input to dedupe's normalization and MinHash signatures.
+func (s *Searcher) windowText(sw scoredWindow) string {
+	frags := highlighter.Fragment(s.CompleteWorks, sw.window, defaultFragmentSize)
+	if len(frags) == 0 {
+		return ""
+	}
+	return frags[0].Text
+}
+
+// buildHit renders a scored window into the REST Hit shape using the
+// Highlighter (see highlight.go). Fragments, PreMatch/PostMatch, and
+// Snippet markup are only populated when highlight is requested; provenance
+// fields are restricted to those named in fields (see applyFieldProjection).
+func (s *Searcher) buildHit(sw scoredWindow, highlight bool, format string, fields []string) Hit {
+	play, act, scene, speaker, _ := s.Provenance(sw.window[0].Pos)
+	hit := Hit{
+		Score:              sw.score,
+		Play:               play,
+		Act:                act,
+		Scene:              scene,
+		Speaker:            speaker,
+		Duplicates:         sw.duplicates,
+		DuplicatePositions: sw.duplicatePositions,
+	}
+	applyFieldProjection(&hit, fields)
+
+	frags := highlighter.Fragment(s.CompleteWorks, sw.window, defaultFragmentSize)
+	if len(frags) == 0 {
+		return hit
+	}
+	frag := frags[0]
+
+	if !highlight {
+		hit.Snippet = frag.Text
+		return hit
+	}
+
+	hit.Snippet = renderFragment(frag, format)
+
+	runes := []rune(frag.Text)
+	firstStart, lastEnd := -1, -1
+	for _, m := range frag.Matches {
+		hit.Fragments = append(hit.Fragments, HitFragment{Start: m.Start, End: m.End, Term: m.Term})
+		if firstStart == -1 || m.Start < firstStart {
+			firstStart = m.Start
+		}
+		if m.End > lastEnd {
+			lastEnd = m.End
+		}
+	}
+	if firstStart > 0 {
+		hit.PreMatch = string(runes[:firstStart])
+	}
+	if lastEnd >= 0 && lastEnd <= len(runes) {
+		hit.PostMatch = string(runes[lastEnd:])
+	}
+
+	return hit
+}
+
+// applyFieldProjection zeroes hit's provenance fields (play, act, scene,
+// speaker) that aren't named in fields. An empty fields list is "no
+// restriction" and leaves hit untouched.
+func applyFieldProjection(hit *Hit, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	want := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		want[strings.ToLower(f)] = true
+	}
+
+	if !want["play"] {
+		hit.Play = ""
+	}
+	if !want["act"] {
+		hit.Act = ""
+	}
+	if !want["scene"] {
+		hit.Scene = ""
+	}
+	if !want["speaker"] {
+		hit.Speaker = ""
+	}
+}
+
+// SearchAPI runs req against the corpus and returns the full REST
+// response, suitable for POST /search.
+func (s *Searcher) SearchAPI(req APIRequest) APIResponse {
+	start := time.Now()
+	windows, replaced, total := s.rankedWindows(req)
+
+	resp := APIResponse{Replaced: replaced, Total: total}
+	if resp.Replaced == nil {
+		resp.Replaced = []Replacement{}
+	}
+	for _, w := range windows {
+		resp.Hits = append(resp.Hits, s.buildHit(w, req.Highlight, req.Format, req.Fields))
+	}
+	resp.TookMs = time.Since(start).Milliseconds()
+	return resp
+}
+
+// handleSearchAPI serves POST /search with the {query,from,size,...} body
+// described above.
+func handleSearchAPI(searcher Searcher) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req APIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid request body"))
+			return
+		}
+
+		resp := searcher.SearchAPI(req)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// handleSearchStream serves /search/stream: the same query, accepted
+// either as a POST body or as GET query params, but written out as
+// newline-delimited JSON hits, flushed as each one is produced, so a UI
+// can render results incrementally instead of waiting for the whole
+// response.
+func handleSearchStream(searcher Searcher) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeStreamRequest(r)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("missing or invalid search query"))
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("streaming unsupported"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+
+		windows, _, _ := searcher.rankedWindows(req)
+		for _, sw := range windows {
+			if err := enc.Encode(searcher.buildHit(sw, req.Highlight, req.Format, req.Fields)); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func decodeStreamRequest(r *http.Request) (APIRequest, bool) {
+	if r.Method == http.MethodPost {
+		var req APIRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Query) < 1 {
+			return APIRequest{}, false
+		}
+		return req, true
+	}
+
+	query, ok := r.URL.Query()["query"]
+	if !ok || len(query[0]) < 1 {
+		query, ok = r.URL.Query()["q"]
+	}
+	if !ok || len(query[0]) < 1 {
+		return APIRequest{}, false
+	}
+
+	var fields []string
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		fields = strings.Split(raw, ",")
+	}
+
+	return APIRequest{
+		Query:     query[0],
+		From:      parseIntParam(r, "from", 0),
+		Size:      parseIntParam(r, "size", 20),
+		Highlight: true,
+		Fields:    fields,
+		Format:    r.URL.Query().Get("format"),
+		Dedupe:    r.URL.Query().Get("dedupe"),
+	}, true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestCorpus writes text to a temp file and loads a Searcher from it,
+// the same way main() loads completeworks.txt.
+func loadTestCorpus(t *testing.T, text string) *Searcher {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Searcher{}
+	if err := s.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return s
+}
+
+// loveLine builds a paragraph containing "Love is <word>" flanked by enough
+// unrelated filler that the Highlighter's ~100-byte fragment window (see
+// highlight.go) never reaches into a neighboring paragraph, so each
+// occurrence's snippet stays distinct.
+func loveLine(n int, word string) string {
+	return fmt.Sprintf("Padding filler line number %d with plenty of unrelated words here today. Love is %s indeed. More unrelated padding filler content continues on for quite a while after this point here today.\n", n, word)
+}
+
+func TestRankedWindowsPaginatesByFromAndSize(t *testing.T) {
+	words := []string{"apple", "banana", "cherry", "date", "fig"}
+	var b strings.Builder
+	for i, w := range words {
+		b.WriteString(loveLine(i, w))
+	}
+	s := loadTestCorpus(t, b.String())
+
+	windows, _, total := s.rankedWindows(APIRequest{Query: "love", From: 0, Size: 2})
+	if total != 5 {
+		t.Fatalf("total = %d, want 5", total)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("len(windows) = %d, want 2", len(windows))
+	}
+	if windows[0].window[0].Pos >= windows[1].window[0].Pos {
+		t.Fatalf("windows should be in ascending corpus order: %+v", windows)
+	}
+
+	rest, _, total := s.rankedWindows(APIRequest{Query: "love", From: 3, Size: 2})
+	if total != 5 {
+		t.Fatalf("total = %d, want 5", total)
+	}
+	if len(rest) != 2 {
+		t.Fatalf("len(rest) = %d, want 2", len(rest))
+	}
+
+	none, _, total := s.rankedWindows(APIRequest{Query: "love", From: 10, Size: 5})
+	if total != 5 {
+		t.Fatalf("total = %d, want 5 (From past the end doesn't change the total)", total)
+	}
+	if len(none) != 0 {
+		t.Fatalf("len(none) = %d, want 0", len(none))
+	}
+}
+
+func TestRankedWindowsDedupeWiring(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(loveLine(0, "apple"))
+	b.WriteString(loveLine(1, "banana"))
+	// Reusing the same paragraph number for both makes these two
+	// byte-identical once fragmented, so "exact" dedupe (the default)
+	// should collapse them into one result.
+	b.WriteString(loveLine(2, "duplicate"))
+	b.WriteString(loveLine(2, "duplicate"))
+	s := loadTestCorpus(t, b.String())
+
+	off, _, totalOff := s.rankedWindows(APIRequest{Query: "love", From: 0, Size: 10, Dedupe: "off"})
+	if totalOff != 4 || len(off) != 4 {
+		t.Fatalf("dedupe=off: total=%d len=%d, want 4/4 (no merging)", totalOff, len(off))
+	}
+
+	exact, _, totalExact := s.rankedWindows(APIRequest{Query: "love", From: 0, Size: 10, Dedupe: "exact"})
+	if totalExact != 3 || len(exact) != 3 {
+		t.Fatalf("dedupe=exact: total=%d len=%d, want 3/3 (the two duplicate lines merged)", totalExact, len(exact))
+	}
+
+	var merged *scoredWindow
+	for i := range exact {
+		if exact[i].duplicates > 0 {
+			merged = &exact[i]
+		}
+	}
+	if merged == nil {
+		t.Fatalf("no merged window found in %+v", exact)
+	}
+	if merged.duplicates != 1 || len(merged.duplicatePositions) != 1 {
+		t.Fatalf("merged = %+v, want exactly one recorded duplicate", merged)
+	}
+}
+
+func TestApplyFieldProjection(t *testing.T) {
+	full := Hit{Play: "Hamlet", Act: "I", Scene: "II", Speaker: "HAMLET"}
+
+	none := full
+	applyFieldProjection(&none, nil)
+	if none.Play != full.Play || none.Act != full.Act || none.Scene != full.Scene || none.Speaker != full.Speaker {
+		t.Fatalf("applyFieldProjection(nil fields) = %+v, want unchanged %+v", none, full)
+	}
+
+	restricted := full
+	applyFieldProjection(&restricted, []string{"Play", "speaker"})
+	if restricted.Play != "Hamlet" || restricted.Speaker != "HAMLET" {
+		t.Fatalf("restricted Play/Speaker = %q/%q, want preserved", restricted.Play, restricted.Speaker)
+	}
+	if restricted.Act != "" || restricted.Scene != "" {
+		t.Fatalf("restricted Act/Scene = %q/%q, want zeroed", restricted.Act, restricted.Scene)
+	}
+}
+
+func TestDecodeStreamRequestParsesGETParams(t *testing.T) {
+	r := httptest.NewRequest("GET", "/search/stream?query=love&from=5&size=15&fields=play,speaker&format=ansi&dedupe=off", nil)
+
+	req, ok := decodeStreamRequest(r)
+	if !ok {
+		t.Fatalf("decodeStreamRequest returned ok=false for a valid GET request")
+	}
+	if req.Query != "love" || req.From != 5 || req.Size != 15 {
+		t.Fatalf("req = %+v, want Query=love From=5 Size=15", req)
+	}
+	if len(req.Fields) != 2 || req.Fields[0] != "play" || req.Fields[1] != "speaker" {
+		t.Fatalf("req.Fields = %v, want [play speaker]", req.Fields)
+	}
+	if req.Format != "ansi" || req.Dedupe != "off" {
+		t.Fatalf("req.Format/Dedupe = %q/%q, want ansi/off", req.Format, req.Dedupe)
+	}
+	if !req.Highlight {
+		t.Fatalf("req.Highlight = false, want true for the GET form (there's no way to opt out)")
+	}
+}
+
+func TestDecodeStreamRequestRejectsMissingQuery(t *testing.T) {
+	r := httptest.NewRequest("GET", "/search/stream", nil)
+	if _, ok := decodeStreamRequest(r); ok {
+		t.Fatalf("decodeStreamRequest should reject a request with no query param")
+	}
+}
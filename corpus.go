@@ -0,0 +1,202 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Line is a single line of dialogue (or stage direction) attributed to a
+// Speaker, with its byte range into CompleteWorks.
+type Line struct {
+	Speaker string
+	Start   int
+	End     int
+}
+
+// Scene is an act's scene, identified by its Gutenberg scene number
+// ("I", "II", ...).
+type Scene struct {
+	Number string
+	Lines  []Line
+}
+
+// Act is a play's act, identified by its Gutenberg act number.
+type Act struct {
+	Number string
+	Scenes []Scene
+}
+
+// Work is a single play or poem, as delimited by its ALL-CAPS title line.
+type Work struct {
+	Title string
+	Acts  []Act
+}
+
+// lineRef flattens a Line with the play/act/scene it belongs to, so that
+// BySceneRange can be binary-searched by byte offset without walking the
+// Works tree.
+type lineRef struct {
+	Play    string
+	Act     string
+	Scene   string
+	Speaker string
+	Start   int
+	End     int
+}
+
+var (
+	titleRegexp   = regexp.MustCompile(`^[A-Z][A-Z0-9 ,'.:;\-]{3,}$`)
+	actRegexp     = regexp.MustCompile(`^ACT\s+([IVXLCDM]+)\b`)
+	sceneRegexp   = regexp.MustCompile(`^SCENE\s+([IVXLCDM]+)\.`)
+	speakerRegexp = regexp.MustCompile(`^([A-Z][A-Z .']{1,30})\.\s*$`)
+)
+
+// parseCorpus segments CompleteWorks into logical records using the
+// Project Gutenberg Complete Works formatting conventions: ALL-CAPS
+// titles, "ACT I", "SCENE II.", and speaker lines in caps followed by a
+// period. It populates s.Works and the ByPlay/ByCharacter/BySceneRange
+// auxiliary indexes used to attach provenance to a match position.
+func (s *Searcher) parseCorpus() {
+	s.ByPlay = map[string]*Work{}
+	s.ByCharacter = map[string][]int{}
+
+	var works []*Work
+	var refs []lineRef
+
+	var work *Work
+	var act *Act
+	var scene *Scene
+	speaker := ""
+
+	cursor := 0
+	for _, raw := range strings.Split(s.CompleteWorks, "\n") {
+		lineStart := cursor
+		lineEnd := cursor + len(raw)
+		cursor = lineEnd + 1 // account for the newline split on
+
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "":
+			// blank lines don't change state
+
+		case actRegexp.MatchString(line):
+			if work == nil {
+				break
+			}
+			m := actRegexp.FindStringSubmatch(line)
+			work.Acts = append(work.Acts, Act{Number: m[1]})
+			act = &work.Acts[len(work.Acts)-1]
+			scene = nil
+			speaker = ""
+
+		case sceneRegexp.MatchString(line):
+			if act == nil {
+				break
+			}
+			m := sceneRegexp.FindStringSubmatch(line)
+			act.Scenes = append(act.Scenes, Scene{Number: m[1]})
+			scene = &act.Scenes[len(act.Scenes)-1]
+			speaker = ""
+
+		case speakerRegexp.MatchString(line) && scene != nil:
+			m := speakerRegexp.FindStringSubmatch(line)
+			speaker = strings.TrimSuffix(strings.TrimSpace(m[1]), ".")
+
+		case titleRegexp.MatchString(line) && !speakerRegexp.MatchString(line):
+			// A title line always starts a new work, regardless of
+			// act/scene state: act and scene are only ever reset to nil
+			// here and in actRegexp's/sceneRegexp's own branches, so
+			// requiring them nil to recognize a title would wrongly
+			// gate this to "only the very first play in the corpus"
+			// once a later play's ACT/SCENE lines left them non-nil.
+			work = &Work{Title: line}
+			works = append(works, work)
+			s.ByPlay[work.Title] = work
+			act = nil
+			scene = nil
+			speaker = ""
+
+		default:
+			if scene == nil {
+				break
+			}
+			l := Line{Speaker: speaker, Start: lineStart, End: lineEnd}
+			scene.Lines = append(scene.Lines, l)
+
+			ref := lineRef{Start: lineStart, End: lineEnd, Speaker: speaker}
+			if work != nil {
+				ref.Play = work.Title
+			}
+			if act != nil {
+				ref.Act = act.Number
+			}
+			ref.Scene = scene.Number
+			refs = append(refs, ref)
+
+			if speaker != "" {
+				s.ByCharacter[speaker] = append(s.ByCharacter[speaker], lineStart)
+			}
+		}
+	}
+
+	for _, w := range works {
+		s.Works = append(s.Works, *w)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Start < refs[j].Start })
+	s.BySceneRange = refs
+}
+
+// FacetCounts groups a query's match counts by play and by speaker, for
+// the /facets endpoint's drill-down filters.
+type FacetCounts struct {
+	ByPlay    map[string]int `json:"byPlay"`
+	BySpeaker map[string]int `json:"bySpeaker"`
+}
+
+// Facets evaluates query and tallies its matches by play and by speaker.
+func (s *Searcher) Facets(query string) FacetCounts {
+	counts := FacetCounts{ByPlay: map[string]int{}, BySpeaker: map[string]int{}}
+	if len(query) < 2 {
+		return counts
+	}
+
+	ast, err := ParseQuery(query)
+	if err != nil {
+		return counts
+	}
+
+	seen := map[int]bool{}
+	for _, h := range ast.Eval(s) {
+		if seen[h.Pos] {
+			continue
+		}
+		seen[h.Pos] = true
+
+		play, _, _, speaker, ok := s.Provenance(h.Pos)
+		if !ok {
+			continue
+		}
+		if play != "" {
+			counts.ByPlay[play]++
+		}
+		if speaker != "" {
+			counts.BySpeaker[speaker]++
+		}
+	}
+
+	return counts
+}
+
+// Provenance returns the play, act, scene and speaker that own the given
+// byte offset into CompleteWorks, found via a binary search over
+// BySceneRange.
+func (s *Searcher) Provenance(pos int) (play, act, scene, speaker string, ok bool) {
+	refs := s.BySceneRange
+	i := sort.Search(len(refs), func(i int) bool { return refs[i].Start > pos }) - 1
+	if i < 0 || i >= len(refs) || pos < refs[i].Start || pos >= refs[i].End {
+		return "", "", "", "", false
+	}
+	r := refs[i]
+	return r.Play, r.Act, r.Scene, r.Speaker, true
+}
@@ -0,0 +1,132 @@
+package main
+
+import "testing"
+
+// sampleCorpus mimics the Project Gutenberg formatting parseCorpus expects:
+// an ALL-CAPS title, "ACT"/"SCENE" headers, and speaker lines in caps
+// followed by a period.
+const sampleCorpus = `THE TRAGEDY OF HAMLET, PRINCE OF DENMARK
+ACT I
+SCENE I. Elsinore. A platform before the castle.
+
+BERNARDO.
+Who's there?
+
+FRANCISCO.
+Nay, answer me. Stand and unfold yourself.
+`
+
+func TestParseCorpusSegmentsWorksAndSpeakers(t *testing.T) {
+	s := &Searcher{CompleteWorks: sampleCorpus}
+	s.parseCorpus()
+
+	if len(s.Works) != 1 {
+		t.Fatalf("Works = %d, want 1", len(s.Works))
+	}
+	work := s.Works[0]
+	if work.Title != "THE TRAGEDY OF HAMLET, PRINCE OF DENMARK" {
+		t.Fatalf("Title = %q", work.Title)
+	}
+	if len(work.Acts) != 1 || work.Acts[0].Number != "I" {
+		t.Fatalf("Acts = %+v, want one act numbered I", work.Acts)
+	}
+	if len(work.Acts[0].Scenes) != 1 || work.Acts[0].Scenes[0].Number != "I" {
+		t.Fatalf("Scenes = %+v, want one scene numbered I", work.Acts[0].Scenes)
+	}
+
+	if _, ok := s.ByCharacter["BERNARDO"]; !ok {
+		t.Fatalf("ByCharacter missing BERNARDO: %+v", s.ByCharacter)
+	}
+	if _, ok := s.ByCharacter["FRANCISCO"]; !ok {
+		t.Fatalf("ByCharacter missing FRANCISCO: %+v", s.ByCharacter)
+	}
+}
+
+func TestParseCorpusProvenance(t *testing.T) {
+	s := &Searcher{CompleteWorks: sampleCorpus}
+	s.parseCorpus()
+
+	pos := -1
+	for _, ref := range s.BySceneRange {
+		if ref.Speaker == "FRANCISCO" {
+			pos = ref.Start
+			break
+		}
+	}
+	if pos < 0 {
+		t.Fatalf("no BySceneRange entry for FRANCISCO: %+v", s.BySceneRange)
+	}
+
+	play, act, scene, speaker, ok := s.Provenance(pos)
+	if !ok {
+		t.Fatalf("Provenance(%d) not found", pos)
+	}
+	if play != "THE TRAGEDY OF HAMLET, PRINCE OF DENMARK" || act != "I" || scene != "I" || speaker != "FRANCISCO" {
+		t.Fatalf("Provenance = %q/%q/%q/%q, want the Hamlet/I/I/FRANCISCO", play, act, scene, speaker)
+	}
+}
+
+func TestProvenanceOutOfRange(t *testing.T) {
+	s := &Searcher{CompleteWorks: sampleCorpus}
+	s.parseCorpus()
+
+	if _, _, _, _, ok := s.Provenance(len(sampleCorpus) + 1000); ok {
+		t.Fatalf("Provenance past the end of the corpus should not resolve")
+	}
+}
+
+// twoPlayCorpus chains a second play directly after the first's only scene,
+// with no blank "end of play" marker in between - the shape that silently
+// merged the second play into the first's Work before act/scene were reset
+// on every title line instead of only when both happened to already be nil.
+const twoPlayCorpus = `THE TRAGEDY OF HAMLET, PRINCE OF DENMARK
+ACT I
+SCENE I. Elsinore. A platform before the castle.
+
+BERNARDO.
+Who's there?
+
+THE TRAGEDY OF MACBETH
+ACT I
+SCENE I. A desert place.
+
+FIRST WITCH.
+When shall we three meet again?
+`
+
+func TestParseCorpusHandlesMultiplePlays(t *testing.T) {
+	s := &Searcher{CompleteWorks: twoPlayCorpus}
+	s.parseCorpus()
+
+	if len(s.Works) != 2 {
+		t.Fatalf("Works = %d, want 2: %+v", len(s.Works), s.Works)
+	}
+	if s.Works[0].Title != "THE TRAGEDY OF HAMLET, PRINCE OF DENMARK" {
+		t.Fatalf("Works[0].Title = %q", s.Works[0].Title)
+	}
+	if s.Works[1].Title != "THE TRAGEDY OF MACBETH" {
+		t.Fatalf("Works[1].Title = %q", s.Works[1].Title)
+	}
+	if len(s.Works[1].Acts) != 1 || len(s.Works[1].Acts[0].Scenes) != 1 {
+		t.Fatalf("Works[1] Acts/Scenes = %+v, want one act with one scene", s.Works[1].Acts)
+	}
+
+	pos := -1
+	for _, ref := range s.BySceneRange {
+		if ref.Speaker == "FIRST WITCH" {
+			pos = ref.Start
+			break
+		}
+	}
+	if pos < 0 {
+		t.Fatalf("no BySceneRange entry for FIRST WITCH: %+v", s.BySceneRange)
+	}
+
+	play, _, _, speaker, ok := s.Provenance(pos)
+	if !ok {
+		t.Fatalf("Provenance(%d) not found", pos)
+	}
+	if play != "THE TRAGEDY OF MACBETH" || speaker != "FIRST WITCH" {
+		t.Fatalf("Provenance = %q/%q, want THE TRAGEDY OF MACBETH/FIRST WITCH", play, speaker)
+	}
+}
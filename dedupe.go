@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	shingleSize      = 4  // k, in the k=4 word shingles used for MinHash
+	minHashFuncs     = 64 // number of hash functions in a MinHash signature
+	jaccardThreshold = 0.8
+
+	// maxFuzzyCandidates bounds the O(n^2) pairwise MinHash comparison: a
+	// common-word query can produce thousands of windows, and fuzzy dedupe
+	// is a client-controlled query param, so an unbounded pass is a cheap
+	// way to pin a core for seconds. Windows are already sorted by score
+	// by the time dedupeWindows runs, so only the top-scoring candidates
+	// are compared; the rest pass through undeduped rather than being
+	// dropped.
+	maxFuzzyCandidates = 500
+)
+
+// normalizeForDedup lowercases text, strips punctuation, and collapses
+// whitespace so near-identical snippets ("My lord!" vs "my lord,") hash
+// to the same key.
+func normalizeForDedup(s string) string {
+	var b strings.Builder
+	lastSpace := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsPunct(r):
+			continue
+		case unicode.IsSpace(r):
+			if !lastSpace && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			lastSpace = true
+		default:
+			b.WriteRune(r)
+			lastSpace = false
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// shingles splits already-normalized text into overlapping runs of k
+// words.
+func shingles(text string, k int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return nil
+	}
+	if len(words) < k {
+		return []string{strings.Join(words, " ")}
+	}
+
+	out := make([]string, 0, len(words)-k+1)
+	for i := 0; i+k <= len(words); i++ {
+		out = append(out, strings.Join(words[i:i+k], " "))
+	}
+	return out
+}
+
+// minHashSignature computes a MinHash signature over text's k=4-word
+// shingles using numHashes independently-salted FNV-1a hashes, for
+// estimating Jaccard similarity without keeping the full shingle sets
+// around.
+func minHashSignature(text string, numHashes int) []uint64 {
+	sig := make([]uint64, numHashes)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+
+	shings := shingles(normalizeForDedup(text), shingleSize)
+	if len(shings) == 0 {
+		return sig
+	}
+
+	var salt [8]byte
+	for _, sh := range shings {
+		for i := 0; i < numHashes; i++ {
+			binary.LittleEndian.PutUint64(salt[:], uint64(i))
+			h := fnv.New64a()
+			h.Write([]byte(sh))
+			h.Write(salt[:])
+			if v := h.Sum64(); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// estimateJaccard approximates the Jaccard similarity of two shingle sets
+// from their MinHash signatures: the fraction of hash functions that
+// picked the same minimum shingle.
+func estimateJaccard(a, b []uint64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	matches := 0
+	for i := range a {
+		if a[i] == b[i] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(a))
+}
+
+// unionFind is a minimal disjoint-set structure used to cluster
+// near-duplicate windows.
+type unionFind struct{ parent []int }
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{parent: make([]int, n)}
+	for i := range uf.parent {
+		uf.parent[i] = i
+	}
+	return uf
+}
+
+func (uf *unionFind) find(x int) int {
+	for uf.parent[x] != x {
+		uf.parent[x] = uf.parent[uf.parent[x]]
+		x = uf.parent[x]
+	}
+	return x
+}
+
+func (uf *unionFind) union(a, b int) {
+	ra, rb := uf.find(a), uf.find(b)
+	if ra != rb {
+		uf.parent[ra] = rb
+	}
+}
+
+// dedupeWindows collapses near-duplicate windows according to mode
+// ("off", "exact", or "fuzzy", default "exact"), keeping the
+// highest-scoring window of each cluster as the representative and
+// recording the rest as its duplicates.
+func dedupeWindows(windows []scoredWindow, text func(scoredWindow) string, mode string) []scoredWindow {
+	if mode == "" {
+		mode = "exact"
+	}
+	if mode == "off" || len(windows) < 2 {
+		return windows
+	}
+
+	n := len(windows)
+	uf := newUnionFind(n)
+
+	switch mode {
+	case "fuzzy":
+		limit := n
+		if limit > maxFuzzyCandidates {
+			log.Printf("dedupe: %d windows exceeds fuzzy cap of %d, skipping fuzzy comparison past the top %d by score", n, maxFuzzyCandidates, maxFuzzyCandidates)
+			limit = maxFuzzyCandidates
+		}
+
+		sigs := make([][]uint64, limit)
+		for i := 0; i < limit; i++ {
+			sigs[i] = minHashSignature(text(windows[i]), minHashFuncs)
+		}
+		for i := 0; i < limit; i++ {
+			for j := i + 1; j < limit; j++ {
+				if estimateJaccard(sigs[i], sigs[j]) > jaccardThreshold {
+					uf.union(i, j)
+				}
+			}
+		}
+	default: // "exact"
+		seen := map[string]int{}
+		for i, w := range windows {
+			key := normalizeForDedup(text(w))
+			if j, ok := seen[key]; ok {
+				uf.union(i, j)
+			} else {
+				seen[key] = i
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	for i := range windows {
+		root := uf.find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	result := make([]scoredWindow, 0, len(groups))
+	for _, members := range groups {
+		best := members[0]
+		for _, m := range members[1:] {
+			if windows[m].score > windows[best].score {
+				best = m
+			}
+		}
+
+		rep := windows[best]
+		for _, m := range members {
+			if m == best {
+				continue
+			}
+			rep.duplicates++
+			rep.duplicatePositions = append(rep.duplicatePositions, windows[m].window[0].Pos)
+		}
+		result = append(result, rep)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].score > result[j].score })
+	return result
+}
@@ -0,0 +1,123 @@
+package main
+
+import "testing"
+
+func TestNormalizeForDedup(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{"My lord!", "my lord"},
+		{"my  lord,   indeed.", "my lord indeed"},
+		{"  leading and trailing  ", "leading and trailing"},
+	}
+	for _, c := range cases {
+		if got := normalizeForDedup(c.in); got != c.want {
+			t.Errorf("normalizeForDedup(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestShingles(t *testing.T) {
+	got := shingles("the quick brown fox jumps", 4)
+	want := []string{"the quick brown fox", "quick brown fox jumps"}
+	if len(got) != len(want) {
+		t.Fatalf("shingles = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("shingles[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestShinglesShortText(t *testing.T) {
+	got := shingles("hi there", 4)
+	if len(got) != 1 || got[0] != "hi there" {
+		t.Fatalf("shingles(short text) = %v, want a single shingle of the whole text", got)
+	}
+}
+
+func TestEstimateJaccardIdenticalAndDistinctText(t *testing.T) {
+	a := minHashSignature("the quick brown fox jumps over the lazy dog", minHashFuncs)
+	b := minHashSignature("the quick brown fox jumps over the lazy dog", minHashFuncs)
+	if sim := estimateJaccard(a, b); sim != 1.0 {
+		t.Fatalf("identical text similarity = %v, want 1.0", sim)
+	}
+
+	c := minHashSignature("a completely unrelated sentence about something else entirely", minHashFuncs)
+	if sim := estimateJaccard(a, c); sim > 0.2 {
+		t.Fatalf("unrelated text similarity = %v, want close to 0", sim)
+	}
+}
+
+func TestUnionFind(t *testing.T) {
+	uf := newUnionFind(5)
+	uf.union(0, 1)
+	uf.union(1, 2)
+	uf.union(3, 4)
+
+	if uf.find(0) != uf.find(2) {
+		t.Fatalf("0 and 2 should be in the same set")
+	}
+	if uf.find(0) == uf.find(3) {
+		t.Fatalf("0 and 3 should be in different sets")
+	}
+}
+
+func TestDedupeWindowsOff(t *testing.T) {
+	windows := []scoredWindow{
+		{window: []matchHit{{Pos: 0}}, score: 1.0},
+		{window: []matchHit{{Pos: 100}}, score: 0.5},
+	}
+	text := func(w scoredWindow) string { return "same text every time" }
+
+	got := dedupeWindows(windows, text, "off")
+	if len(got) != 2 {
+		t.Fatalf("dedupeWindows(off) = %d windows, want 2 (unchanged)", len(got))
+	}
+}
+
+func TestDedupeWindowsExactMergesIdenticalText(t *testing.T) {
+	windows := []scoredWindow{
+		{window: []matchHit{{Pos: 0}}, score: 0.5},
+		{window: []matchHit{{Pos: 100}}, score: 1.0}, // higher score, should win as representative
+		{window: []matchHit{{Pos: 200}}, score: 0.3},
+	}
+	texts := map[int]string{
+		0:   "Good night, sweet prince.",
+		100: "good night sweet prince",
+		200: "a wholly different line",
+	}
+	text := func(w scoredWindow) string { return texts[w.window[0].Pos] }
+
+	got := dedupeWindows(windows, text, "exact")
+	if len(got) != 2 {
+		t.Fatalf("dedupeWindows(exact) = %d windows, want 2", len(got))
+	}
+
+	rep := got[0]
+	if rep.score != 1.0 {
+		t.Fatalf("representative score = %v, want 1.0 (the highest-scoring duplicate)", rep.score)
+	}
+	if rep.duplicates != 1 || len(rep.duplicatePositions) != 1 || rep.duplicatePositions[0] != 0 {
+		t.Fatalf("representative duplicates = %d/%v, want 1/[0]", rep.duplicates, rep.duplicatePositions)
+	}
+}
+
+func TestDedupeWindowsFuzzyMergesNearDuplicates(t *testing.T) {
+	base := "to be or not to be that is the question whether tis nobler in the mind to suffer"
+	windows := []scoredWindow{
+		{window: []matchHit{{Pos: 0}}, score: 1.0},
+		{window: []matchHit{{Pos: 100}}, score: 0.9},
+		{window: []matchHit{{Pos: 200}}, score: 0.2},
+	}
+	texts := map[int]string{
+		0:   base,
+		100: base + " indeed",
+		200: "a wildly unrelated sentence sharing nothing with the others at all",
+	}
+	text := func(w scoredWindow) string { return texts[w.window[0].Pos] }
+
+	got := dedupeWindows(windows, text, "fuzzy")
+	if len(got) != 2 {
+		t.Fatalf("dedupeWindows(fuzzy) = %d windows, want 2", len(got))
+	}
+}
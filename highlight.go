@@ -0,0 +1,219 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultFragmentSize is how many bytes of corpus text a Fragment window
+// spans before being snapped to sentence boundaries.
+const defaultFragmentSize = 100
+
+// Match is a single matched term within a Fragment, given as a [Start,End)
+// rune offset range relative to the start of the Fragment's Text.
+type Match struct {
+	Start int
+	End   int
+	Term  string
+}
+
+// Fragment is a highlighted window of text together with the matches it
+// contains, modeled on Bleve's highlight API.
+type Fragment struct {
+	Text    string
+	Matches []Match
+}
+
+// Highlighter selects and renders fragments of text around search hits.
+// Unlike a single regexp pass over the whole snippet, it picks the window
+// with the highest match density, snaps its edges to sentence boundaries
+// instead of word boundaries, and never slices a multi-byte rune in half.
+type Highlighter struct{}
+
+// Fragment returns the single best window of text around hits: the one
+// containing the most hits within size bytes, expanded outward to the
+// nearest sentence boundaries (.,?,!, or newline).
+func (h Highlighter) Fragment(text string, hits []matchHit, size int) []Fragment {
+	if len(hits) == 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = defaultFragmentSize
+	}
+
+	positions := make([]int, len(hits))
+	for i, hit := range hits {
+		positions[i] = hit.Pos
+	}
+	sort.Ints(positions)
+
+	start, end := densestWindow(text, positions, size)
+	start = snapToSentenceStart(text, start)
+	end = snapToSentenceEnd(text, end)
+	if start >= end {
+		return nil
+	}
+
+	frag := Fragment{Text: text[start:end]}
+	fragRuneLen := utf8.RuneCountInString(frag.Text)
+	for _, hit := range hits {
+		if hit.Pos < start || hit.Pos >= end {
+			continue
+		}
+		matchStart := utf8.RuneCountInString(text[start:hit.Pos])
+
+		// hit.Term is the cleaned word that matched (lowercased,
+		// punctuation stripped), which is usually shorter than the raw
+		// token sitting at hit.Pos in text. Using its length here would
+		// end the highlight inside the word whenever it's followed (or, for
+		// an internal apostrophe like "don't") interrupted by punctuation
+		// cleanWord stripped. A verbatim phrase match's Term is the literal
+		// phrase text instead, so its length is accurate and is used as-is.
+		byteEnd := hit.Pos + len(hit.Term)
+		if !strings.Contains(hit.Term, " ") {
+			byteEnd = wordByteEnd(text, hit.Pos)
+		}
+		if byteEnd > end {
+			byteEnd = end
+		}
+		matchEnd := matchStart + utf8.RuneCountInString(text[hit.Pos:byteEnd])
+		if matchEnd > fragRuneLen {
+			matchEnd = fragRuneLen
+		}
+		frag.Matches = append(frag.Matches, Match{Start: matchStart, End: matchEnd, Term: hit.Term})
+	}
+
+	return []Fragment{frag}
+}
+
+// wordByteEnd returns the byte offset just past the raw token starting at
+// pos: the same whitespace-delimited span Searcher.Load indexed it from,
+// punctuation included.
+func wordByteEnd(text string, pos int) int {
+	end := pos
+	for end < len(text) && text[end] != ' ' && text[end] != '\n' {
+		end++
+	}
+	return end
+}
+
+// densestWindow slides a size-byte window across text, centering it on
+// each candidate hit in turn, and returns the byte range containing the
+// most hits.
+func densestWindow(text string, positions []int, size int) (start, end int) {
+	bestCount := -1
+	bestStart := 0
+
+	for _, p := range positions {
+		candidateStart := p - size/2
+		if candidateStart < 0 {
+			candidateStart = 0
+		}
+		candidateEnd := candidateStart + size
+		if candidateEnd > len(text) {
+			candidateEnd = len(text)
+			candidateStart = candidateEnd - size
+			if candidateStart < 0 {
+				candidateStart = 0
+			}
+		}
+
+		count := 0
+		for _, q := range positions {
+			if q >= candidateStart && q < candidateEnd {
+				count++
+			}
+		}
+		if count > bestCount {
+			bestCount = count
+			bestStart = candidateStart
+		}
+	}
+
+	start = runeBoundary(text, bestStart)
+	end = runeBoundary(text, bestStart+size)
+	if end > len(text) {
+		end = len(text)
+	}
+	return start, end
+}
+
+// runeBoundary walks idx backward until it sits on a valid UTF-8 rune
+// boundary, so a window edge never splits a multi-byte rune.
+func runeBoundary(text string, idx int) int {
+	if idx <= 0 {
+		return 0
+	}
+	if idx >= len(text) {
+		return len(text)
+	}
+	for idx > 0 && !utf8.RuneStart(text[idx]) {
+		idx--
+	}
+	return idx
+}
+
+func isSentenceBoundary(b byte) bool {
+	return b == '.' || b == '?' || b == '!' || b == '\n'
+}
+
+// snapToSentenceStart walks backward from idx to the end of the nearest
+// preceding sentence boundary, or the start of text if there isn't one.
+func snapToSentenceStart(text string, idx int) int {
+	idx = runeBoundary(text, idx)
+	for i := idx; i > 0; i-- {
+		if isSentenceBoundary(text[i-1]) {
+			return runeBoundary(text, i)
+		}
+	}
+	return 0
+}
+
+// snapToSentenceEnd walks forward from idx to the nearest following
+// sentence boundary (inclusive), or the end of text if there isn't one.
+func snapToSentenceEnd(text string, idx int) int {
+	idx = runeBoundary(text, idx)
+	for i := idx; i < len(text); i++ {
+		if isSentenceBoundary(text[i]) {
+			return runeBoundary(text, i+1)
+		}
+	}
+	return len(text)
+}
+
+// renderFragment renders a Fragment's matches as markup, per format:
+// "html" wraps them in <mark> tags (the default), "ansi" bolds them with
+// terminal escapes, and "none" returns the plain text untouched.
+func renderFragment(f Fragment, format string) string {
+	switch format {
+	case "none":
+		return f.Text
+	case "ansi":
+		return markRunes(f, "\x1b[1m", "\x1b[0m")
+	default:
+		return markRunes(f, "<mark>", "</mark>")
+	}
+}
+
+func markRunes(f Fragment, open, close string) string {
+	runes := []rune(f.Text)
+
+	matches := append([]Match(nil), f.Matches...)
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start > matches[j].Start })
+
+	for _, m := range matches {
+		if m.Start < 0 || m.End > len(runes) || m.Start > m.End {
+			continue
+		}
+		merged := make([]rune, 0, len(runes)+utf8.RuneCountInString(open)+utf8.RuneCountInString(close))
+		merged = append(merged, runes[:m.Start]...)
+		merged = append(merged, []rune(open)...)
+		merged = append(merged, runes[m.Start:m.End]...)
+		merged = append(merged, []rune(close)...)
+		merged = append(merged, runes[m.End:]...)
+		runes = merged
+	}
+
+	return string(runes)
+}
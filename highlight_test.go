@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestRuneBoundarySkipsContinuationBytes(t *testing.T) {
+	text := "café bar"
+	// byte 3 is the first (lead) byte of 'é'; byte 4 is its continuation
+	// byte and must never be treated as a valid slice edge.
+	if got := runeBoundary(text, 4); got != 3 {
+		t.Fatalf("runeBoundary(text, 4) = %d, want 3", got)
+	}
+	if got := runeBoundary(text, 3); got != 3 {
+		t.Fatalf("runeBoundary(text, 3) = %d, want 3", got)
+	}
+}
+
+func TestSnapToSentenceBoundaries(t *testing.T) {
+	text := "First sentence. Second sentence. Third sentence."
+
+	if got := snapToSentenceStart(text, 20); got != 15 {
+		t.Fatalf("snapToSentenceStart(20) = %d, want 15 (just past the first period)", got)
+	}
+	if got := snapToSentenceEnd(text, 20); got != 32 {
+		t.Fatalf("snapToSentenceEnd(20) = %d, want 32 (just past the second period)", got)
+	}
+	if got := snapToSentenceStart(text, 3); got != 0 {
+		t.Fatalf("snapToSentenceStart(3) = %d, want 0 (no boundary before it)", got)
+	}
+	if got := snapToSentenceEnd(text, len(text)); got != len(text) {
+		t.Fatalf("snapToSentenceEnd(len(text)) = %d, want %d", got, len(text))
+	}
+}
+
+func TestFragmentWordMatchExtendsPastCleanedTermLength(t *testing.T) {
+	h := Highlighter{}
+	text := "I don't know"
+	hits := []matchHit{{Pos: 2, Term: "dont"}}
+
+	frags := h.Fragment(text, hits, 100)
+	if len(frags) != 1 {
+		t.Fatalf("Fragment returned %d fragments, want 1", len(frags))
+	}
+	frag := frags[0]
+	if len(frag.Matches) != 1 {
+		t.Fatalf("Matches = %+v, want exactly one", frag.Matches)
+	}
+	m := frag.Matches[0]
+	// hit.Term ("dont") is the cleaned word (4 runes) but the raw token at
+	// hit.Pos is "don't" (5 runes, apostrophe included). The match should
+	// cover the whole raw token, not stop short at the cleaned length.
+	if got := string([]rune(frag.Text)[m.Start:m.End]); got != "don't" {
+		t.Fatalf("matched text = %q, want %q", got, "don't")
+	}
+}
+
+func TestFragmentPhraseMatchUsesLiteralLength(t *testing.T) {
+	h := Highlighter{}
+	text := "to be or not to be"
+	hits := []matchHit{{Pos: 0, Term: "to be"}}
+
+	frags := h.Fragment(text, hits, 100)
+	if len(frags) != 1 {
+		t.Fatalf("Fragment returned %d fragments, want 1", len(frags))
+	}
+	frag := frags[0]
+	if len(frag.Matches) != 1 {
+		t.Fatalf("Matches = %+v, want exactly one", frag.Matches)
+	}
+	m := frag.Matches[0]
+	if got := string([]rune(frag.Text)[m.Start:m.End]); got != "to be" {
+		t.Fatalf("matched text = %q, want %q", got, "to be")
+	}
+}
+
+func TestFragmentReturnsNilWithoutHits(t *testing.T) {
+	h := Highlighter{}
+	if got := h.Fragment("some text", nil, 100); got != nil {
+		t.Fatalf("Fragment(no hits) = %v, want nil", got)
+	}
+}
+
+func TestRenderFragmentFormats(t *testing.T) {
+	frag := Fragment{Text: "hello world", Matches: []Match{{Start: 0, End: 5, Term: "hello"}}}
+
+	if got := renderFragment(frag, "html"); got != "<mark>hello</mark> world" {
+		t.Fatalf("renderFragment(html) = %q", got)
+	}
+	if got := renderFragment(frag, "ansi"); got != "\x1b[1mhello\x1b[0m world" {
+		t.Fatalf("renderFragment(ansi) = %q", got)
+	}
+	if got := renderFragment(frag, "none"); got != "hello world" {
+		t.Fatalf("renderFragment(none) = %q, want the plain text unmarked", got)
+	}
+}
+
+func TestMarkRunesHandlesMultipleMatchesWithoutOffsetDrift(t *testing.T) {
+	frag := Fragment{
+		Text: "a b c d",
+		Matches: []Match{
+			{Start: 0, End: 1, Term: "a"},
+			{Start: 4, End: 5, Term: "c"},
+		},
+	}
+	if got := renderFragment(frag, "html"); got != "<mark>a</mark> b <mark>c</mark> d" {
+		t.Fatalf("renderFragment with multiple matches = %q", got)
+	}
+}
@@ -4,17 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"index/suffixarray"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
-
-	"github.com/xrash/smetrics"
 )
 
 func main() {
@@ -28,6 +25,8 @@ func main() {
 	http.Handle("/", fs)
 
 	http.HandleFunc("/search", handleSearch(searcher))
+	http.HandleFunc("/search/stream", handleSearchStream(searcher))
+	http.HandleFunc("/facets", handleFacets(searcher))
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -41,27 +40,76 @@ func main() {
 	}
 }
 
-// SearchResults is a map that stores a map of
-// strings with a string array used to output results
-type SearchResults map[string][]string
+// SearchResults is the JSON shape returned by /search: a ranked, paginated
+// list of scored snippets.
+type SearchResults struct {
+	Results  []ScoredSnippet `json:"results"`
+	Replaced []string        `json:"replaced"`
+	Time     string          `json:"time"`
+}
+
+// wordOcc is a single occurrence of a word in CompleteWorks: its rune
+// offset (for snippet extraction) and its sequential word number across
+// the whole corpus (for phrase adjacency checks).
+type wordOcc struct {
+	Pos int
+	Seq int
+}
 
 // Searcher handles loading our corpus and searching it
 type Searcher struct {
 	CompleteWorks string
 	// Words represent words in the body of text, including the positions
 	// where they're found so we can easily show the results later
-	Words map[string][]int
+	Words map[string][]wordOcc
+	// TotalWords is the total number of word occurrences in the corpus,
+	// used as N in the IDF boost applied during scoring.
+	TotalWords int
+
+	// Works holds the corpus segmented into plays, acts, scenes and
+	// speaker lines (see corpus.go), used to attach provenance to
+	// matches and to answer field queries like play:Hamlet.
+	Works        []Work
+	ByPlay       map[string]*Work
+	ByCharacter  map[string][]int
+	BySceneRange []lineRef
+
+	// SuffixIndex backs exact phrase and substring matching (see
+	// suffix.go); it finds literal runs of text, punctuation included,
+	// that the word index can't.
+	SuffixIndex *suffixarray.Index
+	// normalizedOffsets maps a byte offset into the normalized copy of
+	// CompleteWorks that SuffixIndex was built over back to the matching
+	// byte offset in CompleteWorks itself.
+	normalizedOffsets []int
 }
 
+// handleSearch serves GET /search (the original q=/query= form, kept for
+// compatibility) and delegates POST /search to the REST API in api.go.
 func handleSearch(searcher Searcher) func(w http.ResponseWriter, r *http.Request) {
+	apiHandler := handleSearchAPI(searcher)
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		query, ok := r.URL.Query()["q"]
+		if r.Method == http.MethodPost {
+			apiHandler(w, r)
+			return
+		}
+
+		query, ok := r.URL.Query()["query"]
+		if !ok || len(query[0]) < 1 {
+			query, ok = r.URL.Query()["q"]
+		}
 		if !ok || len(query[0]) < 1 {
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte("missing search query in URL params"))
 			return
 		}
-		results := searcher.Search(query[0])
+
+		limit := parseIntParam(r, "limit", 10)
+		offset := parseIntParam(r, "offset", 0)
+		dedupe := r.URL.Query().Get("dedupe")
+
+		results := searcher.Search(query[0], limit, offset, dedupe)
 		buf := &bytes.Buffer{}
 		enc := json.NewEncoder(buf)
 		err := enc.Encode(results)
@@ -75,6 +123,45 @@ func handleSearch(searcher Searcher) func(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func handleFacets(searcher Searcher) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := r.URL.Query()["query"]
+		if !ok || len(query[0]) < 1 {
+			query, ok = r.URL.Query()["q"]
+		}
+		if !ok || len(query[0]) < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("missing search query in URL params"))
+			return
+		}
+
+		counts := searcher.Facets(query[0])
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		if err := enc.Encode(counts); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("encoding failure"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf.Bytes())
+	}
+}
+
+// parseIntParam reads an integer query param, falling back to def if it's
+// missing or malformed.
+func parseIntParam(r *http.Request, name string, def int) int {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
 // cleanWord removes punctuation, whitespace and other characters from words
 // as well as converts it to lowercase
 func cleanWord(s string) string {
@@ -97,199 +184,77 @@ func (s *Searcher) Load(filename string) error {
 		return fmt.Errorf("Load: %w", err)
 	}
 	s.CompleteWorks = string(dat)
-	s.Words = map[string][]int{}
+	s.Words = map[string][]wordOcc{}
 
-	// Go through all the words and split them manually,
-	// so we can easily keep track of our index (position)
+	// Go through all the words and split them manually, so we can easily
+	// keep track of both the rune offset (for snippets) and the
+	// sequential word number (for phrase adjacency).
 	var sb strings.Builder
+	seq := 0
+	wordStart := 0
 	for i, r := range s.CompleteWorks {
+		if sb.Len() == 0 {
+			wordStart = i
+		}
+
 		if (r == ' ' || r == '\n') && sb.Len() > 1 {
 			word := cleanWord(sb.String())
 			sb.Reset()
 
-			s.Words[word] = append(s.Words[word], i-utf8.RuneCountInString(word))
+			// wordStart is the byte offset of the raw token's first rune,
+			// recorded before any punctuation cleanWord goes on to strip
+			// from it. Deriving Pos from the cleaned word's length instead
+			// would point it into the word whenever cleanWord stripped
+			// leading or trailing punctuation.
+			s.Words[word] = append(s.Words[word], wordOcc{Pos: wordStart, Seq: seq})
+			seq++
 			continue
 		}
 
 		sb.WriteRune(r)
 	}
 
-	return nil
-}
-
-// Search takes an input query and returns results from
-// our corpus based on the words contained
-func (s *Searcher) Search(query string) SearchResults {
-	start := time.Now()
-	results := SearchResults{}
-	results["replaced"] = []string{}
-
-	// We shouldn't search for letters
-	if len(query) < 2 {
-		t := time.Now()
-		elapsed := t.Sub(start)
-		results["time"] = []string{fmt.Sprintf("%v", elapsed)}
-		return results
-	}
-
-	// Find all the valid, unique queries (words) and clean them up
-	queryMap := map[string]bool{}
-	rawQueries := []string{}
-	for _, query := range strings.Split(query, " ") {
-		query = cleanWord(query)
-		if len(query) > 1 {
-			if !queryMap[query] {
-				rawQueries = append(rawQueries, query)
-			}
-			queryMap[query] = true
-		}
-	}
-
-	// Account for spelling mistakes by looking at similar words
-	missingQueries := []string{}
-	replacedQueries := map[string]string{}
-	bestSimilarityScore := map[string]float64{}
-	queries := []string{}
-	for _, query := range rawQueries {
-		if len(s.Words[query]) == 0 {
-			missingQueries = append(missingQueries, query)
-
-			for word := range s.Words {
-				// TODO: Similarity could be stored as a score, and then each cluster's
-				// score computed according to the sum. This would bubble up
-				// exact matches and more similar words and allow better results
-				similarity := smetrics.JaroWinkler(query, word, 0.5, 3)
-				if bestSimilarityScore[query] < similarity && similarity > 0.85 {
-					bestSimilarityScore[query] = similarity
-					replacedQueries[query] = word
-				}
-			}
-
-		} else {
-			queries = append(queries, query)
-		}
-	}
-
-	// Do we still have more missing queries than ones we replaced?
-	// If so, we got no results for this search
-	if len(missingQueries) > len(replacedQueries) {
-		t := time.Now()
-		elapsed := t.Sub(start)
-		results["time"] = []string{fmt.Sprintf("%v", elapsed)}
-		return results
-	}
-
-	// Make the replaced queries the new search
-	for original, query := range replacedQueries {
-		// TODO: Output JSON structure needs to be better defined and these need to be a KV pair
-		results["replaced"] = append(results["replaced"], []string{original, query}...)
-		queries = append(queries, query)
-	}
-
-	// Get a map and list of all the positions our words appear in
-	positions := map[int]string{}
-	positionList := []int{}
-	for _, query = range queries {
-		for i := 0; i < len(s.Words[query]); i++ {
-			positions[s.Words[query][i]] = query
-			positionList = append(positionList, s.Words[query][i])
-		}
-	}
-
-	// No results?
-	if len(positionList) < 1 {
-		t := time.Now()
-		elapsed := t.Sub(start)
-		results["time"] = []string{fmt.Sprintf("%v", elapsed)}
-		return results
+	for _, occs := range s.Words {
+		s.TotalWords += len(occs)
 	}
 
-	// Sort our positions to build clusters
-	sort.Ints(positionList)
-
-	// Max distance in runes between one word and the next in a cluster
-	maxDistance := 50
-
-	// Build the clusters
-	clusters := [][]int{}
-	cluster := []int{}
-	for i := 0; i < len(positionList)-1; i++ {
-		cluster = append(cluster, positionList[i])
-		if positionList[i+1]-positionList[i]+utf8.RuneCountInString(positions[positionList[i]]) > maxDistance {
-			if len(cluster) > 0 {
-				clusters = append(clusters, cluster)
-				cluster = []int{}
-			}
-
-			continue
-		}
+	s.parseCorpus()
 
-	}
-	clusters = append(clusters, cluster)
-
-	// Validate the clusters making sure each one has all our search words
-	validClusters := [][]int{}
-	for _, c := range clusters {
-		// If this cluster contains less words than our
-		// search query, it can't be a good match
-		if len(c) < len(queries) {
-			continue
-		}
+	return s.buildSuffixIndex(filename)
+}
 
-		// A cluster of a single term is always valid for single-term searches
-		if len(c) == 1 && len(queries) == 1 {
-			validClusters = append(validClusters, c)
-			continue
-		}
+// Search takes an input query, scores and ranks the matching snippets, and
+// returns up to limit of them starting at offset. dedupe selects how
+// near-duplicate snippets are collapsed ("off", "exact", or "fuzzy"; see
+// dedupe.go). It's a thin legacy wrapper around the same
+// rankedWindows/buildHit core the REST API uses (see api.go), kept so the
+// original GET /search JSON shape still works.
+func (s *Searcher) Search(query string, limit, offset int, dedupe string) SearchResults {
+	start := time.Now()
+	windows, replaced, _ := s.rankedWindows(APIRequest{Query: query, From: offset, Size: limit, Highlight: true, Dedupe: dedupe})
 
-		// Which unique terms does this cluster contain?
-		terms := map[string]bool{}
-		for i := 0; i < len(c); i++ {
-			terms[positions[c[i]]] = true
-		}
-		if len(terms) == len(queries) {
-			validClusters = append(validClusters, c)
-		}
+	results := SearchResults{Replaced: []string{}}
+	for _, r := range replaced {
+		results.Replaced = append(results.Replaced, r.From)
 	}
 
-	// Return snippet results for all our valid clusters
-	snippetSurround := 50 // chars of surrounding text to include
-	for _, c := range validClusters {
-		if len(c) == 0 {
-			continue
-		}
-
-		snippet := s.CompleteWorks[c[0]-snippetSurround : c[len(c)-1]+snippetSurround]
-
-		// We don't want to break the snippet mid words, so start working inwards till the first space
-		for i := range snippet {
-			if snippet[i] == ' ' {
-				snippet = snippet[i:]
-				break
-			}
-		}
-		lastSpace := -1
-		for i := range snippet {
-			if snippet[i] == ' ' {
-				lastSpace = i
-			}
-		}
-		if lastSpace > -1 {
-			snippet = snippet[0:lastSpace]
-		}
-
-		// Bold all the matches so it's visually easier for the user
-		// to recognize his search in the results
-		for _, query := range queries {
-			searchRegex := regexp.MustCompile("(?i)(" + query + ")")
-			snippet = searchRegex.ReplaceAllString(snippet, "<b>$1</b>")
-		}
-
-		results["results"] = append(results["results"], snippet)
+	for _, sw := range windows {
+		_, matched, matchedReplaced := s.scoreWindow(sw.window)
+		hit := s.buildHit(sw, true, "html", nil)
+		results.Results = append(results.Results, ScoredSnippet{
+			Snippet:            hit.Snippet,
+			Score:              sw.score,
+			MatchedTerms:       matched,
+			ReplacedTerms:      matchedReplaced,
+			Play:               hit.Play,
+			Act:                hit.Act,
+			Scene:              hit.Scene,
+			Speaker:            hit.Speaker,
+			Duplicates:         hit.Duplicates,
+			DuplicatePositions: hit.DuplicatePositions,
+		})
 	}
 
-	t := time.Now()
-	elapsed := t.Sub(start)
-	results["time"] = []string{fmt.Sprintf("%v", elapsed)}
+	results.Time = fmt.Sprintf("%v", time.Since(start))
 	return results
 }
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xrash/smetrics"
+)
+
+// matchHit is a single occurrence of a query term in the corpus, expressed
+// both as a rune offset (for snippet extraction) and a sequential word
+// number (for phrase adjacency checks).
+type matchHit struct {
+	Pos    int
+	Seq    int
+	Term   string
+	Weight float64
+	// Original is set to the query term the user actually typed when Term
+	// is a fuzzy replacement for it, so callers can report "from -> to".
+	Original string
+}
+
+// Query is a single node of a parsed search expression. Implementations
+// walk the Searcher's posting lists and return the hits that satisfy the
+// node, so that BooleanQuery can intersect/union/subtract its children.
+type Query interface {
+	Eval(s *Searcher) []matchHit
+}
+
+// TermQuery matches a single word, falling back to the closest
+// Jaro-Winkler match when the word itself isn't in the corpus.
+type TermQuery struct {
+	Term string
+}
+
+func (t *TermQuery) Eval(s *Searcher) []matchHit {
+	term := t.Term
+	weight := 1.0
+	original := ""
+
+	if _, ok := s.Words[term]; !ok {
+		best := ""
+		bestScore := 0.0
+		for word := range s.Words {
+			score := smetrics.JaroWinkler(term, word, 0.5, 3)
+			if score > bestScore && score > 0.85 {
+				bestScore = score
+				best = word
+			}
+		}
+		if best == "" {
+			return nil
+		}
+		original = term
+		term = best
+		weight = bestScore
+	}
+
+	occs := s.Words[term]
+	hits := make([]matchHit, len(occs))
+	for i, o := range occs {
+		hits[i] = matchHit{Pos: o.Pos, Seq: o.Seq, Term: term, Weight: weight, Original: original}
+	}
+	return hits
+}
+
+// PhraseQuery matches an exact, in-order run of words, e.g.
+// "to be or not to be". When a suffix array backend is available it is
+// used to find the literal text (punctuation included); otherwise the
+// query falls back to checking that the word sequence numbers in the
+// word index are consecutive.
+type PhraseQuery struct {
+	Raw   string // the phrase as written, e.g. `O, Romeo!`
+	Terms []string
+}
+
+func (p *PhraseQuery) Eval(s *Searcher) []matchHit {
+	if s.SuffixIndex != nil && p.Raw != "" {
+		positions := s.SearchPhrase(p.Raw, -1)
+		hits := make([]matchHit, len(positions))
+		for i, pos := range positions {
+			hits[i] = matchHit{Pos: pos, Term: p.Raw, Weight: 1.0}
+		}
+		return hits
+	}
+
+	if len(p.Terms) == 0 {
+		return nil
+	}
+	if len(p.Terms) == 1 {
+		return (&TermQuery{Term: p.Terms[0]}).Eval(s)
+	}
+
+	first := s.Words[p.Terms[0]]
+	var hits []matchHit
+	for _, start := range first {
+		matched := []matchHit{{Pos: start.Pos, Seq: start.Seq, Term: p.Terms[0], Weight: 1.0}}
+		seq := start.Seq
+		ok := true
+		for _, term := range p.Terms[1:] {
+			next, found := nextOccurrence(s.Words[term], seq+1)
+			if !found {
+				ok = false
+				break
+			}
+			matched = append(matched, matchHit{Pos: next.Pos, Seq: next.Seq, Term: term, Weight: 1.0})
+			seq = next.Seq
+		}
+		if ok {
+			hits = append(hits, matched...)
+		}
+	}
+	return hits
+}
+
+// nextOccurrence returns the occurrence of a word at the exact sequence
+// number, since a phrase match requires consecutive word numbers rather
+// than merely the next occurrence of the word anywhere in the corpus.
+func nextOccurrence(occs []wordOcc, seq int) (wordOcc, bool) {
+	for _, o := range occs {
+		if o.Seq == seq {
+			return o, true
+		}
+		if o.Seq > seq {
+			break
+		}
+	}
+	return wordOcc{}, false
+}
+
+// FieldQuery restricts matches to records where Field equals Value, e.g.
+// play:Hamlet or speaker:Macbeth. Evaluated on its own it yields a hit at
+// the start of every line satisfying the field; combined with other
+// clauses in a BooleanQuery, it's instead used to filter the other
+// clauses' windows (see BooleanQuery.Eval), since a field's lines can
+// span a whole scene rather than sit within one cluster window.
+type FieldQuery struct {
+	Field string
+	Value string
+}
+
+func (f *FieldQuery) Eval(s *Searcher) []matchHit {
+	// Play/speaker records are stored as their raw Gutenberg text (e.g. the
+	// ALL-CAPS title line "THE TRAGEDY OF HAMLET, PRINCE OF DENMARK"), so a
+	// short, natural value like "Hamlet" is matched as a substring rather
+	// than requiring an exact match against that raw text.
+	value := strings.ToLower(strings.Trim(f.Value, `"`))
+	var hits []matchHit
+
+	switch f.Field {
+	case "play":
+		for _, ref := range s.BySceneRange {
+			if strings.Contains(strings.ToLower(ref.Play), value) {
+				hits = append(hits, matchHit{Pos: ref.Start, Term: "play:" + f.Value, Weight: 1.0})
+			}
+		}
+	case "speaker":
+		for speaker, positions := range s.ByCharacter {
+			if !strings.Contains(strings.ToLower(speaker), value) {
+				continue
+			}
+			for _, pos := range positions {
+				hits = append(hits, matchHit{Pos: pos, Term: "speaker:" + f.Value, Weight: 1.0})
+			}
+		}
+	}
+
+	sortHitsByPos(hits)
+	return hits
+}
+
+// BooleanQuery combines child queries with must/should/mustNot semantics.
+// Must clauses are intersected, should clauses are unioned, and mustNot
+// clauses remove any hit found within the same cluster window.
+type BooleanQuery struct {
+	Must    []Query
+	Should  []Query
+	MustNot []Query
+}
+
+const clusterWindow = 50 // max rune distance between hits in the same window
+
+// fieldWindow is how close a field hit (e.g. a speaker's line) has to be
+// to a term window to satisfy a FieldQuery. Field queries apply at
+// scene/play granularity rather than the tight term-cluster window, since
+// a speaker's line can be much longer than 50 runes.
+const fieldWindow = 4000
+
+func (b *BooleanQuery) Eval(s *Searcher) []matchHit {
+	var all []matchHit
+	var fieldMust [][]matchHit
+	for _, q := range b.Must {
+		if fq, ok := q.(*FieldQuery); ok {
+			fieldMust = append(fieldMust, fq.Eval(s))
+			continue
+		}
+		all = append(all, q.Eval(s)...)
+	}
+	for _, q := range b.Should {
+		all = append(all, q.Eval(s)...)
+	}
+	if len(all) == 0 {
+		if len(fieldMust) == 0 {
+			return nil
+		}
+		// A query that's entirely field clauses, e.g. `play:Hamlet`.
+		all = fieldMust[0]
+		fieldMust = fieldMust[1:]
+	}
+
+	windows := buildWindows(all, clusterWindow)
+
+	required := 0
+	for _, q := range b.Must {
+		if _, ok := q.(*FieldQuery); !ok {
+			required++
+		}
+	}
+
+	var excluded []matchHit
+	var fieldExcluded [][]matchHit
+	for _, q := range b.MustNot {
+		if fq, ok := q.(*FieldQuery); ok {
+			fieldExcluded = append(fieldExcluded, fq.Eval(s))
+			continue
+		}
+		excluded = append(excluded, q.Eval(s)...)
+	}
+	sortHitsByPos(excluded)
+
+	var results []matchHit
+	for _, w := range windows {
+		if !windowSatisfiesAllFields(w, fieldMust) {
+			continue
+		}
+		if windowSatisfiesAnyField(w, fieldExcluded) {
+			continue
+		}
+		if required > 0 {
+			terms := map[string]bool{}
+			for _, h := range w {
+				terms[h.Term] = true
+			}
+			if len(terms) < required {
+				continue
+			}
+		}
+		if windowContainsAny(w, excluded, clusterWindow) {
+			continue
+		}
+		results = append(results, w...)
+	}
+	return results
+}
+
+// buildWindows groups hits, sorted by position, into clusters where
+// consecutive hits are no more than maxDistance runes apart.
+func buildWindows(hits []matchHit, maxDistance int) [][]matchHit {
+	sortHitsByPos(hits)
+
+	var windows [][]matchHit
+	var current []matchHit
+	for i, h := range hits {
+		current = append(current, h)
+		if i == len(hits)-1 || hits[i+1].Pos-h.Pos > maxDistance {
+			windows = append(windows, current)
+			current = nil
+		}
+	}
+	return windows
+}
+
+// windowSatisfiesAllFields reports whether w is near a hit from every one
+// of the given field-query hit sets.
+func windowSatisfiesAllFields(w []matchHit, fieldSets [][]matchHit) bool {
+	for _, set := range fieldSets {
+		if !windowContainsAny(w, set, fieldWindow) {
+			return false
+		}
+	}
+	return true
+}
+
+// windowSatisfiesAnyField reports whether w is near a hit from any one of
+// the given field-query hit sets (used to apply mustNot field clauses).
+func windowSatisfiesAnyField(w []matchHit, fieldSets [][]matchHit) bool {
+	for _, set := range fieldSets {
+		if windowContainsAny(w, set, fieldWindow) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowContainsAny reports whether any hit in w sits within maxDistance
+// of any hit in excluded. Both are sorted by Pos (buildWindows and
+// FieldQuery.Eval/the mustNot collection in BooleanQuery.Eval guarantee
+// this), so it's a merge-join: at each step only the pointer behind the
+// other can possibly produce a closer pair, so advancing it is always
+// enough, giving O(len(w)+len(excluded)) instead of the naive O(n*m).
+func windowContainsAny(w []matchHit, excluded []matchHit, maxDistance int) bool {
+	i, j := 0, 0
+	for i < len(w) && j < len(excluded) {
+		diff := w[i].Pos - excluded[j].Pos
+		if abs(diff) <= maxDistance {
+			return true
+		}
+		if diff < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+	return false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sortHitsByPos(hits []matchHit) {
+	for i := 1; i < len(hits); i++ {
+		for j := i; j > 0 && hits[j-1].Pos > hits[j].Pos; j-- {
+			hits[j-1], hits[j] = hits[j], hits[j-1]
+		}
+	}
+}
+
+// ParseQuery turns a query string such as
+// `"to be or not to be" AND play:Hamlet -witch` into a Query AST.
+//
+// Terms are implicitly AND-ed together. A leading "-" marks a clause as
+// mustNot, "OR" groups the surrounding terms into a should clause,
+// "field:value" produces a FieldQuery, and double-quoted text produces a
+// PhraseQuery.
+func ParseQuery(raw string) (Query, error) {
+	tokens, err := tokenizeQuery(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("ParseQuery: empty query")
+	}
+
+	b := &BooleanQuery{}
+	var orGroup []Query
+	for i, tok := range tokens {
+		if strings.EqualFold(tok, "AND") {
+			continue
+		}
+		if strings.EqualFold(tok, "OR") {
+			continue
+		}
+		q, negate := parseClause(tok)
+
+		prevOr := i > 0 && strings.EqualFold(tokens[i-1], "OR")
+		nextOr := i < len(tokens)-1 && strings.EqualFold(tokens[i+1], "OR")
+		if negate {
+			b.MustNot = append(b.MustNot, q)
+		} else if prevOr || nextOr {
+			orGroup = append(orGroup, q)
+			if !nextOr {
+				b.Must = append(b.Must, &BooleanQuery{Should: orGroup})
+				orGroup = nil
+			}
+		} else {
+			b.Must = append(b.Must, q)
+		}
+	}
+
+	if len(b.Must) == 1 && len(b.MustNot) == 0 {
+		return b.Must[0], nil
+	}
+	return b, nil
+}
+
+// parseClause turns a single token into a Query, stripping any leading
+// "-" negation marker.
+func parseClause(tok string) (q Query, negate bool) {
+	if strings.HasPrefix(tok, "-") && len(tok) > 1 {
+		negate = true
+		tok = tok[1:]
+	}
+
+	if strings.HasPrefix(tok, `"`) && strings.HasSuffix(tok, `"`) && len(tok) > 1 {
+		phrase := strings.Trim(tok, `"`)
+		words := strings.Fields(phrase)
+		terms := make([]string, 0, len(words))
+		for _, w := range words {
+			terms = append(terms, cleanWord(w))
+		}
+		return &PhraseQuery{Raw: phrase, Terms: terms}, negate
+	}
+
+	if idx := strings.Index(tok, ":"); idx > 0 {
+		field := tok[:idx]
+		value := strings.Trim(tok[idx+1:], `"`)
+		if field == "play" || field == "speaker" {
+			return &FieldQuery{Field: field, Value: value}, negate
+		}
+	}
+
+	return &TermQuery{Term: cleanWord(tok)}, negate
+}
+
+// tokenizeQuery splits a raw query on whitespace while keeping
+// double-quoted phrases intact as a single token.
+func tokenizeQuery(raw string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	inQuotes := false
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			cur.WriteRune(r)
+		case r == ' ' && !inQuotes:
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("tokenizeQuery: unterminated quote in %q", raw)
+	}
+	flush()
+	return tokens, nil
+}
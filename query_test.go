@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQueryClauses(t *testing.T) {
+	cases := []struct {
+		name      string
+		query     string
+		wantMust  int
+		wantNot   int
+		checkKind func(t *testing.T, q Query)
+	}{
+		{
+			name:     "single term",
+			query:    "love",
+			wantMust: 1,
+			checkKind: func(t *testing.T, q Query) {
+				if _, ok := q.(*TermQuery); !ok {
+					t.Fatalf("got %T, want *TermQuery", q)
+				}
+			},
+		},
+		{
+			name:     "phrase",
+			query:    `"to be or not to be"`,
+			wantMust: 1,
+			checkKind: func(t *testing.T, q Query) {
+				if _, ok := q.(*PhraseQuery); !ok {
+					t.Fatalf("got %T, want *PhraseQuery", q)
+				}
+			},
+		},
+		{
+			name:     "field clause",
+			query:    "play:Hamlet",
+			wantMust: 1,
+			checkKind: func(t *testing.T, q Query) {
+				fq, ok := q.(*FieldQuery)
+				if !ok {
+					t.Fatalf("got %T, want *FieldQuery", q)
+				}
+				if fq.Field != "play" || fq.Value != "Hamlet" {
+					t.Fatalf("got FieldQuery{%q,%q}, want {play,Hamlet}", fq.Field, fq.Value)
+				}
+			},
+		},
+		{
+			name:     "negated term",
+			query:    "love -death",
+			wantMust: 1,
+			wantNot:  1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := ParseQuery(c.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q): %v", c.query, err)
+			}
+
+			b, ok := got.(*BooleanQuery)
+			if !ok {
+				b = &BooleanQuery{Must: []Query{got}}
+			}
+			if len(b.Must) != c.wantMust {
+				t.Fatalf("Must = %d, want %d", len(b.Must), c.wantMust)
+			}
+			if len(b.MustNot) != c.wantNot {
+				t.Fatalf("MustNot = %d, want %d", len(b.MustNot), c.wantNot)
+			}
+			if c.checkKind != nil {
+				c.checkKind(t, b.Must[0])
+			}
+		})
+	}
+}
+
+func TestParseQueryQuotedFieldValue(t *testing.T) {
+	q, err := ParseQuery(`play:"the tragedy of hamlet"`)
+	if err != nil {
+		t.Fatalf("ParseQuery: %v", err)
+	}
+	fq, ok := q.(*FieldQuery)
+	if !ok {
+		t.Fatalf("got %T, want *FieldQuery", q)
+	}
+	if fq.Value != "the tragedy of hamlet" {
+		t.Fatalf("Value = %q, want the quotes stripped", fq.Value)
+	}
+}
+
+func TestFieldQueryEvalMatchesSubstring(t *testing.T) {
+	s := &Searcher{
+		BySceneRange: []lineRef{
+			{Play: "THE TRAGEDY OF HAMLET, PRINCE OF DENMARK", Start: 0, End: 10},
+			{Play: "THE TRAGEDY OF ROMEO AND JULIET", Start: 10, End: 20},
+		},
+	}
+
+	fq := &FieldQuery{Field: "play", Value: "Hamlet"}
+	hits := fq.Eval(s)
+	if len(hits) != 1 || hits[0].Pos != 0 {
+		t.Fatalf("play:Hamlet hits = %+v, want exactly the Hamlet line", hits)
+	}
+}
+
+func TestWindowContainsAny(t *testing.T) {
+	cases := []struct {
+		name        string
+		w           []matchHit
+		excluded    []matchHit
+		maxDistance int
+		want        bool
+	}{
+		{
+			name:        "no overlap",
+			w:           []matchHit{{Pos: 0}, {Pos: 100}},
+			excluded:    []matchHit{{Pos: 500}},
+			maxDistance: 10,
+			want:        false,
+		},
+		{
+			name:        "within distance",
+			w:           []matchHit{{Pos: 0}, {Pos: 100}},
+			excluded:    []matchHit{{Pos: 105}},
+			maxDistance: 10,
+			want:        true,
+		},
+		{
+			name:        "excluded interleaved before and after",
+			w:           []matchHit{{Pos: 50}},
+			excluded:    []matchHit{{Pos: 0}, {Pos: 20}, {Pos: 52}, {Pos: 1000}},
+			maxDistance: 5,
+			want:        true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := windowContainsAny(c.w, c.excluded, c.maxDistance); got != c.want {
+				t.Fatalf("windowContainsAny = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestBuildWindows(t *testing.T) {
+	hits := []matchHit{{Pos: 100}, {Pos: 10}, {Pos: 15}, {Pos: 1000}}
+	got := buildWindows(hits, 50)
+
+	want := [][]int{{10, 15}, {100}, {1000}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d windows, want %d", len(got), len(want))
+	}
+	for i, w := range got {
+		positions := make([]int, len(w))
+		for j, h := range w {
+			positions[j] = h.Pos
+		}
+		if !reflect.DeepEqual(positions, want[i]) {
+			t.Fatalf("window %d = %v, want %v", i, positions, want[i])
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+)
+
+// ScoredSnippet is a single ranked search result.
+type ScoredSnippet struct {
+	Snippet       string   `json:"snippet"`
+	Score         float64  `json:"score"`
+	MatchedTerms  []string `json:"matchedTerms"`
+	ReplacedTerms []string `json:"replacedTerms,omitempty"`
+
+	// Provenance, filled in from the window's first hit when the corpus
+	// has been segmented into plays/acts/scenes (see corpus.go).
+	Play    string `json:"play,omitempty"`
+	Act     string `json:"act,omitempty"`
+	Scene   string `json:"scene,omitempty"`
+	Speaker string `json:"speaker,omitempty"`
+
+	// Duplicates and DuplicatePositions are filled in when dedupe merged
+	// one or more near-identical snippets into this one (see dedupe.go).
+	Duplicates         int   `json:"duplicates,omitempty"`
+	DuplicatePositions []int `json:"duplicatePositions,omitempty"`
+}
+
+// scoreWindow scores a cluster of hits as
+// sum(termWeight_i) / (1 + spread), where termWeight_i is 1.0 for an exact
+// match and the Jaro-Winkler similarity for a fuzzy-replaced term, spread is
+// the distance between the window's first and last hit, and each term
+// weight gets an IDF boost of log(N / df(term)).
+func (s *Searcher) scoreWindow(w []matchHit) (score float64, matched, replaced []string) {
+	if len(w) == 0 {
+		return 0, nil, nil
+	}
+
+	lo, hi := w[0].Pos, w[0].Pos
+	seen := map[string]bool{}
+	seenReplaced := map[string]bool{}
+	for _, h := range w {
+		if h.Pos < lo {
+			lo = h.Pos
+		}
+		if h.Pos > hi {
+			hi = h.Pos
+		}
+
+		df := len(s.Words[h.Term])
+		idf := 1.0
+		if df > 0 && s.TotalWords > 0 {
+			idf = math.Log(float64(s.TotalWords) / float64(df))
+			if idf < 1.0 {
+				idf = 1.0
+			}
+		}
+		score += h.Weight * idf
+
+		if !seen[h.Term] {
+			matched = append(matched, h.Term)
+			seen[h.Term] = true
+		}
+		if h.Weight < 1.0 && !seenReplaced[h.Term] {
+			replaced = append(replaced, h.Term)
+			seenReplaced[h.Term] = true
+		}
+	}
+
+	spread := hi - lo
+	score = score / (1 + float64(spread))
+	return score, matched, replaced
+}
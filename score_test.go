@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreWindowIDFClamp(t *testing.T) {
+	s := &Searcher{
+		Words: map[string][]wordOcc{
+			"the": {{Pos: 0}, {Pos: 10}, {Pos: 20}, {Pos: 30}},
+		},
+		TotalWords: 4,
+	}
+
+	w := []matchHit{{Pos: 0, Term: "the", Weight: 1.0}}
+	score, matched, replaced := s.scoreWindow(w)
+
+	// df == TotalWords means log(N/df) == log(1) == 0, which must be
+	// clamped up to the floor of 1.0 rather than zeroing the term out.
+	if score != 1.0 {
+		t.Fatalf("score = %v, want 1.0 (idf clamped to 1.0)", score)
+	}
+	if len(matched) != 1 || matched[0] != "the" {
+		t.Fatalf("matched = %v, want [the]", matched)
+	}
+	if len(replaced) != 0 {
+		t.Fatalf("replaced = %v, want none (weight is 1.0)", replaced)
+	}
+}
+
+func TestScoreWindowIDFBoostsRareTerms(t *testing.T) {
+	s := &Searcher{
+		Words: map[string][]wordOcc{
+			"common": {{Pos: 0}, {Pos: 10}, {Pos: 20}, {Pos: 30}},
+			"rare":   {{Pos: 0}},
+		},
+		TotalWords: 100,
+	}
+
+	common, _, _ := s.scoreWindow([]matchHit{{Pos: 0, Term: "common", Weight: 1.0}})
+	rare, _, _ := s.scoreWindow([]matchHit{{Pos: 0, Term: "rare", Weight: 1.0}})
+
+	if rare <= common {
+		t.Fatalf("rare term score %v should exceed common term score %v", rare, common)
+	}
+	wantRare := math.Log(100.0 / 1.0)
+	if math.Abs(rare-wantRare) > 1e-9 {
+		t.Fatalf("rare score = %v, want %v", rare, wantRare)
+	}
+}
+
+func TestScoreWindowSpreadPenalty(t *testing.T) {
+	s := &Searcher{
+		Words: map[string][]wordOcc{
+			"a": {{Pos: 0}},
+			"b": {{Pos: 0}},
+		},
+		TotalWords: 2,
+	}
+
+	tight, _, _ := s.scoreWindow([]matchHit{{Pos: 0, Term: "a", Weight: 1.0}, {Pos: 5, Term: "b", Weight: 1.0}})
+	wide, _, _ := s.scoreWindow([]matchHit{{Pos: 0, Term: "a", Weight: 1.0}, {Pos: 50, Term: "b", Weight: 1.0}})
+
+	if wide >= tight {
+		t.Fatalf("wider spread score %v should be lower than tighter spread score %v", wide, tight)
+	}
+}
+
+func TestScoreWindowTracksReplacedTerms(t *testing.T) {
+	s := &Searcher{
+		Words: map[string][]wordOcc{
+			"love": {{Pos: 0}},
+		},
+		TotalWords: 1,
+	}
+
+	_, matched, replaced := s.scoreWindow([]matchHit{{Pos: 0, Term: "love", Weight: 0.9, Original: "lov"}})
+	if len(matched) != 1 || matched[0] != "love" {
+		t.Fatalf("matched = %v, want [love]", matched)
+	}
+	if len(replaced) != 1 || replaced[0] != "love" {
+		t.Fatalf("replaced = %v, want [love] (fuzzy weight < 1.0)", replaced)
+	}
+}
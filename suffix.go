@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"index/suffixarray"
+	"os"
+	"sort"
+	"syscall"
+	"unicode"
+)
+
+// suffixCacheSuffix is appended to the corpus filename to derive where the
+// serialized suffix array index is cached between boots.
+const suffixCacheSuffix = ".sa"
+
+// cacheHeaderSize is the size, in bytes, of the staleness header written
+// before the serialized suffix array index: the corpus file's size and
+// mtime at the time the cache was built, as two little-endian uint64s.
+const cacheHeaderSize = 16
+
+// buildSuffixIndex builds the suffix array backend used for exact phrase
+// and substring matching: a *suffixarray.Index over a normalized lowercase
+// copy of CompleteWorks, plus a parallel offset table so positions found in
+// the normalized copy can be translated back into CompleteWorks. The index
+// is cached on disk next to corpusFile and mmap'd back in on later boots so
+// the 5MB corpus doesn't have to be re-indexed every time the server starts.
+func (s *Searcher) buildSuffixIndex(corpusFile string) error {
+	normalized, offsets := normalizeForSuffixIndex(s.CompleteWorks)
+	s.normalizedOffsets = offsets
+
+	info, err := os.Stat(corpusFile)
+	if err != nil {
+		return err
+	}
+
+	cachePath := corpusFile + suffixCacheSuffix
+	if idx, err := loadCachedSuffixIndex(cachePath, info); err == nil {
+		s.SuffixIndex = idx
+		return nil
+	}
+
+	s.SuffixIndex = suffixarray.New(normalized)
+	return s.saveSuffixIndex(cachePath, info)
+}
+
+// normalizeForSuffixIndex lowercases text for case-insensitive phrase
+// lookups while recording, for every byte of the result, which byte offset
+// in the original text it came from. Lower-casing a rune can change its
+// UTF-8 byte length, so the two byte streams aren't always aligned 1:1.
+// Newlines are folded to a single space so a phrase that happens to wrap
+// across a line break in the source formatting still matches byte-for-byte
+// against a query written with an ordinary space; SearchPhrase runs the
+// query side through this same function, so both sides fold the same way.
+func normalizeForSuffixIndex(text string) (normalized []byte, offsets []int) {
+	var buf bytes.Buffer
+	buf.Grow(len(text))
+
+	for i, r := range text {
+		lower := unicode.ToLower(r)
+		if lower == '\n' {
+			lower = ' '
+		}
+		n := buf.Len()
+		buf.WriteRune(lower)
+		for j := n; j < buf.Len(); j++ {
+			offsets = append(offsets, i)
+		}
+	}
+
+	return buf.Bytes(), offsets
+}
+
+// saveSuffixIndex serializes idx to cachePath, preceded by a small header
+// recording corpusInfo's size and mtime, so a later boot can tell whether
+// the corpus file has changed since the cache was built.
+func (s *Searcher) saveSuffixIndex(cachePath string, corpusInfo os.FileInfo) error {
+	f, err := os.Create(cachePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var header [cacheHeaderSize]byte
+	binary.LittleEndian.PutUint64(header[0:8], uint64(corpusInfo.Size()))
+	binary.LittleEndian.PutUint64(header[8:16], uint64(corpusInfo.ModTime().UnixNano()))
+	if _, err := f.Write(header[:]); err != nil {
+		return err
+	}
+
+	return s.SuffixIndex.Write(f)
+}
+
+// loadCachedSuffixIndex mmaps a previously-saved index file and decodes it
+// in place, avoiding a copy of the (multi-megabyte) serialized index. It
+// refuses the cache if corpusInfo's size or mtime don't match the header
+// saveSuffixIndex wrote, so a corpus file updated without deleting its
+// cache doesn't serve phrase/substring results against stale offsets.
+func loadCachedSuffixIndex(cachePath string, corpusInfo os.FileInfo) (*suffixarray.Index, error) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() <= cacheHeaderSize {
+		return nil, os.ErrInvalid
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	wantSize := uint64(corpusInfo.Size())
+	wantModTime := uint64(corpusInfo.ModTime().UnixNano())
+	if binary.LittleEndian.Uint64(data[0:8]) != wantSize || binary.LittleEndian.Uint64(data[8:16]) != wantModTime {
+		syscall.Munmap(data)
+		return nil, fmt.Errorf("loadCachedSuffixIndex: stale cache for %s (corpus size/mtime changed)", cachePath)
+	}
+
+	idx := &suffixarray.Index{}
+	if err := idx.Read(bytes.NewReader(data[cacheHeaderSize:])); err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	return idx, nil
+}
+
+// SearchPhrase finds literal occurrences (including punctuation, e.g.
+// "O, Romeo!") of s in the corpus using the suffix array, and returns up to
+// limit match positions as byte offsets into CompleteWorks. limit < 0 means
+// unlimited, matching suffixarray.Index.Lookup's own convention.
+func (s *Searcher) SearchPhrase(phrase string, limit int) []int {
+	if s.SuffixIndex == nil || phrase == "" {
+		return nil
+	}
+
+	normalized, _ := normalizeForSuffixIndex(phrase)
+	matches := s.SuffixIndex.Lookup(normalized, limit)
+
+	positions := make([]int, 0, len(matches))
+	for _, m := range matches {
+		if m < 0 || m >= len(s.normalizedOffsets) {
+			continue
+		}
+		positions = append(positions, s.normalizedOffsets[m])
+	}
+	sort.Ints(positions)
+	return positions
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildSuffixIndexCachesAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	corpusPath := filepath.Join(dir, "corpus.txt")
+	text := "the quick brown fox"
+	if err := os.WriteFile(corpusPath, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Searcher{CompleteWorks: text}
+	if err := s.buildSuffixIndex(corpusPath); err != nil {
+		t.Fatalf("buildSuffixIndex: %v", err)
+	}
+	if s.SuffixIndex == nil {
+		t.Fatal("SuffixIndex is nil after build")
+	}
+	if _, err := os.Stat(corpusPath + suffixCacheSuffix); err != nil {
+		t.Fatalf("expected a cache file at %s: %v", corpusPath+suffixCacheSuffix, err)
+	}
+
+	// A second Searcher over the same, unchanged corpus file should load
+	// the cache instead of rebuilding, and find the same matches.
+	s2 := &Searcher{CompleteWorks: text}
+	if err := s2.buildSuffixIndex(corpusPath); err != nil {
+		t.Fatalf("buildSuffixIndex (cached): %v", err)
+	}
+	got := s2.SearchPhrase("quick brown", -1)
+	if len(got) != 1 || got[0] != 4 {
+		t.Fatalf("SearchPhrase after cache reload = %v, want [4]", got)
+	}
+}
+
+func TestSuffixCacheInvalidatedWhenCorpusChanges(t *testing.T) {
+	dir := t.TempDir()
+	corpusPath := filepath.Join(dir, "corpus.txt")
+	if err := os.WriteFile(corpusPath, []byte("the quick brown fox"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Searcher{CompleteWorks: "the quick brown fox"}
+	if err := s.buildSuffixIndex(corpusPath); err != nil {
+		t.Fatalf("buildSuffixIndex: %v", err)
+	}
+
+	// Rewrite the corpus file in place (same path, different content and a
+	// distinct mtime) without touching the cache file saveSuffixIndex left
+	// behind, the way a restart against an updated completeworks.txt would.
+	newText := "a completely different sentence"
+	if err := os.WriteFile(corpusPath, []byte(newText), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newModTime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(corpusPath, newModTime, newModTime); err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := &Searcher{CompleteWorks: newText}
+	if err := s2.buildSuffixIndex(corpusPath); err != nil {
+		t.Fatalf("buildSuffixIndex after corpus change: %v", err)
+	}
+
+	if got := s2.SearchPhrase("completely different", -1); len(got) != 1 {
+		t.Fatalf("SearchPhrase on rebuilt index = %v, want one match", got)
+	}
+	if got := s2.SearchPhrase("quick brown", -1); len(got) != 0 {
+		t.Fatalf("SearchPhrase found stale text %v, cache should have been rebuilt", got)
+	}
+}
+
+func TestNormalizeForSuffixIndexFoldsNewlinesAndLowercases(t *testing.T) {
+	normalized, offsets := normalizeForSuffixIndex("Good\nNight")
+	if string(normalized) != "good night" {
+		t.Fatalf("normalized = %q, want %q", normalized, "good night")
+	}
+	if len(offsets) != len(normalized) {
+		t.Fatalf("offsets len = %d, want %d (one per output byte)", len(offsets), len(normalized))
+	}
+}
+
+func TestSearchPhraseMatchesAcrossALineWrap(t *testing.T) {
+	dir := t.TempDir()
+	corpusPath := filepath.Join(dir, "corpus.txt")
+	text := "to be or not to\nbe, that is the question"
+	if err := os.WriteFile(corpusPath, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Searcher{CompleteWorks: text}
+	if err := s.buildSuffixIndex(corpusPath); err != nil {
+		t.Fatalf("buildSuffixIndex: %v", err)
+	}
+
+	if got := s.SearchPhrase("not to be", -1); len(got) != 1 {
+		t.Fatalf("SearchPhrase(%q) = %v, want one match spanning the line wrap", "not to be", got)
+	}
+}